@@ -8,12 +8,17 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
-	"strings"
 	"sync"
 
+	"github.com/go-zeromq/zmq4/transport"
 	"github.com/pkg/errors"
 )
 
+// maxDatagramSize is the largest PGM/EPGM datagram Conn.readMulticast
+// will read in one call; publishers are expected to fragment larger
+// messages across multiple frames/datagrams themselves.
+const maxDatagramSize = 65507
+
 // Conn implements the ZeroMQ Message Transport Protocol as defined
 // in https://rfc.zeromq.org/spec:23/ZMTP/.
 type Conn struct {
@@ -28,11 +33,31 @@ type Conn struct {
 		Meta   Metadata
 	}
 
-	mu     sync.RWMutex
-	topics map[string]struct{} // set of subscribed topics
+	mu      sync.RWMutex
+	matcher Matcher // tracks subscribed topics; defaults to a prefix trie
+
+	// verbose/verboser implement XPUB_VERBOSE/XPUB_VERBOSER: when set,
+	// every inbound SUBSCRIBE/UNSUBSCRIBE is forwarded to subNotify,
+	// including duplicate subscriptions (verbose) and duplicate
+	// unsubscriptions (verboser), instead of only the first/last one.
+	verbose   bool
+	verboser  bool
+	subNotify func(Msg)
+
+	heartbeat HeartbeatOptions
+	hb        heartbeatState
+
+	// multicast is set when rw came from a transport.Conn reporting
+	// Multicast() == true (e.g. pgm://, epgm://). Per RFC 23, such
+	// transports carry raw datagrams instead of a ZMTP byte-stream, so
+	// both the greeting/security handshake and the frame header are
+	// skipped entirely, and topic filtering happens on the receive
+	// side instead of the send side.
+	multicast bool
 }
 
 func (c *Conn) Close() error {
+	c.stopHeartbeat()
 	return c.rw.Close()
 }
 
@@ -44,9 +69,15 @@ func (c *Conn) Write(p []byte) (int, error) {
 	return c.rw.Write(p)
 }
 
-// Open opens a ZMTP connection over rw with the given security, socket type and identity.
-// Open performs a complete ZMTP handshake.
-func Open(rw io.ReadWriteCloser, sec Security, sockType SocketType, sockID SocketIdentity, server bool) (*Conn, error) {
+// Open opens a ZMTP connection over rw with the given security, socket
+// type and identity. Open performs a complete ZMTP handshake.
+//
+// heartbeat configures the ZMTP 3.1 PING-PONG keepalive for the
+// connection; it must be supplied here, rather than via Heartbeat,
+// because the version advertised in the greeting (sent before Open
+// returns) depends on whether heartbeating is enabled. Pass the zero
+// HeartbeatOptions to disable heartbeating.
+func Open(rw io.ReadWriteCloser, sec Security, sockType SocketType, sockID SocketIdentity, server bool, heartbeat HeartbeatOptions) (*Conn, error) {
 	if rw == nil {
 		return nil, errors.Errorf("zmq4: invalid nil read-writer")
 	}
@@ -56,23 +87,36 @@ func Open(rw io.ReadWriteCloser, sec Security, sockType SocketType, sockID Socke
 	}
 
 	conn := &Conn{
-		typ:    sockType,
-		id:     sockID,
-		rw:     rw,
-		sec:    sec,
-		Server: server,
-		Meta:   make(Metadata),
-		topics: make(map[string]struct{}),
+		typ:       sockType,
+		id:        sockID,
+		rw:        rw,
+		sec:       sec,
+		Server:    server,
+		Meta:      make(Metadata),
+		matcher:   newTrieMatcher(),
+		heartbeat: heartbeat,
 	}
 	conn.Meta[sysSockType] = string(conn.typ)
 	conn.Meta[sysSockID] = conn.id.String()
 	conn.Peer.Meta = make(Metadata)
 
+	if mc, ok := rw.(transport.Conn); ok && mc.Multicast() {
+		// Multicast transports (PGM/EPGM) skip the ZMTP greeting and
+		// security handshake altogether: there is no per-peer
+		// byte-stream to negotiate, only a shared datagram group.
+		conn.multicast = true
+		return conn, nil
+	}
+
 	err := conn.init(sec)
 	if err != nil {
 		return nil, err
 	}
 
+	if heartbeat.IVL > 0 {
+		conn.startHeartbeat()
+	}
+
 	return conn, nil
 }
 
@@ -106,6 +150,11 @@ func (conn *Conn) init(sec Security) error {
 func (conn *Conn) greet(server bool) error {
 	var err error
 	send := greeting{Version: defaultVersion}
+	if conn.heartbeat.IVL > 0 {
+		// PING-PONG was introduced in ZMTP 3.1; advertise it so the
+		// peer knows to expect (and answer) our heartbeats.
+		send.Version = version3_1
+	}
 	send.Sig.Header = sigHeader
 	send.Sig.Footer = sigFooter
 	kind := string(conn.sec.Type())
@@ -170,7 +219,36 @@ func (c *Conn) RecvMsg() (Msg, error) {
 	if msg.err != nil {
 		return msg, errors.WithStack(msg.err)
 	}
+	c.touch()
 
+	return c.handleCmd(msg)
+}
+
+// RecvMsgInto receives a ZMTP message from the wire into dst, reusing
+// dst.Frames' existing backing arrays where they already have enough
+// capacity for the incoming frame, and pulling any extra storage from
+// the shared buffer pool instead of allocating fresh slices. Frames
+// that cannot be reused (e.g. rewritten to an unrelated, differently
+// sized command body) still get a freshly pooled buffer.
+func (c *Conn) RecvMsgInto(dst *Msg) error {
+	// Pass dst.Frames at its original length, not sliced to [:0]: readFrames
+	// needs to see each existing dst.Frames[idx] (and its capacity) to reuse
+	// its backing array, and truncates it to build the output itself.
+	msg := c.readFrames(dst.Frames)
+	if msg.err != nil {
+		return errors.WithStack(msg.err)
+	}
+	c.touch()
+
+	out, err := c.handleCmd(msg)
+	*dst = out
+	return err
+}
+
+// handleCmd finishes processing a Msg returned by read/readFrames: it
+// passes messages through unchanged, and for commands, answers PINGs
+// and unwraps the command body into msg.Frames.
+func (c *Conn) handleCmd(msg Msg) (Msg, error) {
 	if !msg.isCmd() {
 		return msg, nil
 	}
@@ -194,8 +272,14 @@ func (c *Conn) RecvMsg() (Msg, error) {
 
 	switch cmd.Name {
 	case CmdPing:
-		// send back a PONG immediately.
-		msg.err = c.SendCmd(CmdPong, nil)
+		// send back a PONG immediately, echoing the PING's context
+		// (the body minus its 2-byte TTL prefix) as required by
+		// https://rfc.zeromq.org/spec:23/ZMTP/ 3.1's PING-PONG.
+		var context []byte
+		if len(cmd.Body) > 2 {
+			context = cmd.Body[2:]
+		}
+		msg.err = c.SendCmd(CmdPong, context)
 		if msg.err != nil {
 			return msg, msg.err
 		}
@@ -217,6 +301,7 @@ func (c *Conn) RecvCmd() (Cmd, error) {
 	if msg.err != nil {
 		return cmd, errors.WithStack(msg.err)
 	}
+	c.touch()
 
 	if !msg.isCmd() {
 		return cmd, ErrBadFrame
@@ -242,6 +327,14 @@ func (c *Conn) RecvCmd() (Cmd, error) {
 }
 
 func (c *Conn) send(isCommand bool, body []byte, flag byte) error {
+	if c.multicast {
+		if isCommand {
+			return errors.Errorf("zmq4: multicast transport does not support ZMTP commands")
+		}
+		_, err := c.rw.Write(body)
+		return err
+	}
+
 	// Long flag
 	size := len(body)
 	isLong := size > 255
@@ -270,6 +363,18 @@ func (c *Conn) send(isCommand bool, body []byte, flag byte) error {
 		return err
 	}
 
+	if bs, ok := c.sec.(BufferSecurity); ok {
+		dst := getBuffer(len(body) + secOverhead)
+		defer putBuffer(dst)
+
+		out, err := bs.EncryptInto(dst[:0], body)
+		if err != nil {
+			return err
+		}
+		_, err = c.rw.Write(out)
+		return err
+	}
+
 	if _, err := c.sec.Encrypt(c.rw, body); err != nil {
 		return err
 	}
@@ -279,6 +384,18 @@ func (c *Conn) send(isCommand bool, body []byte, flag byte) error {
 
 // read returns the isCommand flag, the body of the message, and optionally an error
 func (c *Conn) read() Msg {
+	return c.readFrames(nil)
+}
+
+// readFrames is like read, but reuses reuse[i]'s backing array for the
+// i-th frame when it already has enough capacity, instead of always
+// allocating a fresh []byte; any additional storage needed comes from
+// the shared buffer pool rather than make([]byte, size).
+func (c *Conn) readFrames(reuse [][]byte) Msg {
+	if c.multicast {
+		return c.readMulticast()
+	}
+
 	var (
 		header  [2]byte
 		longHdr [8]byte
@@ -286,7 +403,14 @@ func (c *Conn) read() Msg {
 
 		hasMore = true
 		isCmd   = false
+		idx     = 0
 	)
+	// Build the output over reuse's own backing array: frameBuffer checks
+	// reuse[idx] (at its original length) for a reusable buffer, and each
+	// append below only ever (re)writes index idx right after frameBuffer
+	// read it, so growing msg.Frames in place never clobbers a not-yet-read
+	// reuse[idx+1].
+	msg.Frames = reuse[:0]
 
 	for hasMore {
 
@@ -322,11 +446,12 @@ func (c *Conn) read() Msg {
 			return msg
 		}
 
-		body := make([]byte, size)
+		body, pooled := c.frameBuffer(idx, int(size), reuse)
 		_, msg.err = io.ReadFull(c.rw, body)
 		if msg.err != nil {
 			return msg
 		}
+		idx++
 
 		// fast path for NULL security: we bypass the bytes.Buffer allocation.
 		switch c.sec.Type() {
@@ -335,6 +460,19 @@ func (c *Conn) read() Msg {
 			continue
 		}
 
+		if bs, ok := c.sec.(BufferSecurity); ok {
+			out, err := bs.DecryptInto(c.decryptScratch(reuse != nil), body)
+			if pooled {
+				putBuffer(body)
+			}
+			if err != nil {
+				msg.err = err
+				return msg
+			}
+			msg.Frames = append(msg.Frames, out)
+			continue
+		}
+
 		buf := new(bytes.Buffer)
 		if _, msg.err = c.sec.Decrypt(buf, body); msg.err != nil {
 			return msg
@@ -347,30 +485,115 @@ func (c *Conn) read() Msg {
 	return msg
 }
 
+// frameBuffer returns a []byte of length size for the idx-th frame,
+// reusing reuse[idx]'s backing array when it is already large enough,
+// and otherwise drawing one from the shared buffer pool (reporting
+// pooled=true so the caller knows it may later return it via
+// putBuffer).
+//
+// When reuse is nil (the plain RecvMsg/RecvCmd path, which has no
+// persistent *Msg to adopt a grown buffer into and no API for the
+// caller to hand one back), frameBuffer allocates directly instead of
+// drawing from the pool: a pooled buffer that can never be returned is
+// pure pool churn, not reuse.
+func (c *Conn) frameBuffer(idx, size int, reuse [][]byte) (buf []byte, pooled bool) {
+	if idx < len(reuse) && cap(reuse[idx]) >= size {
+		return reuse[idx][:size], false
+	}
+	if reuse == nil {
+		return make([]byte, size), false
+	}
+	return getBuffer(size), true
+}
+
+// decryptScratch returns the destination buffer BufferSecurity.DecryptInto
+// should grow into. Like frameBuffer, it only draws from the shared pool
+// when called from the RecvMsgInto path (persistent, so the grown buffer
+// is adopted into the caller's dst.Frames and reused on the next call);
+// plain RecvMsg/RecvCmd calls get a buffer they own outright, since
+// nothing will ever return it to the pool.
+func (c *Conn) decryptScratch(persistent bool) []byte {
+	if persistent {
+		return getBuffer(0)[:0]
+	}
+	return nil
+}
+
+// readMulticast reads one raw datagram off a multicast transport (no
+// ZMTP frame header) and applies topic filtering on the receive side:
+// every subscriber on the group sees every publish, so a SUB socket
+// drops datagrams that don't match any of its subscriptions instead of
+// relying on the publisher to filter before sending.
+func (c *Conn) readMulticast() Msg {
+	var msg Msg
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, err := c.rw.Read(buf)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+
+		frame := make([]byte, n)
+		copy(frame, buf[:n])
+
+		if c.typ == SUB && !c.subscribed(string(frame)) {
+			continue
+		}
+
+		msg.Frames = [][]byte{frame}
+		return msg
+	}
+}
+
+// SetXPubVerbose implements the XPUB_VERBOSE/XPUB_VERBOSER socket
+// options: when verbose is set, every inbound SUBSCRIBE/UNSUBSCRIBE is
+// forwarded to the notify callback registered via SubscribeNotify, even
+// if it duplicates an existing subscription; when verboser is also
+// set, this applies to UNSUBSCRIBE even while other references to the
+// topic remain.
+func (conn *Conn) SetXPubVerbose(verbose, verboser bool) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.verbose = verbose
+	conn.verboser = verboser
+}
+
+// SubscribeNotify registers fn to be called with the raw
+// SUBSCRIBE/UNSUBSCRIBE message whenever a peer (un)subscribes, as
+// required to build XPUB-style brokers on top of Conn. Whether
+// duplicate (un)subscriptions are forwarded is controlled by
+// SetXPubVerbose.
+func (conn *Conn) SubscribeNotify(fn func(Msg)) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.subNotify = fn
+}
+
 func (conn *Conn) subscribe(msg Msg) {
 	conn.mu.Lock()
 	v := msg.Frames[0]
 	k := string(v[1:])
+
+	var forward bool
 	switch v[0] {
 	case 0:
-		delete(conn.topics, k)
+		isRemoved := conn.matcher.Unsubscribe(k)
+		forward = isRemoved || conn.verboser
 	case 1:
-		conn.topics[k] = struct{}{}
+		isNew := conn.matcher.Subscribe(k)
+		forward = isNew || conn.verbose
 	}
+	notify := conn.subNotify
 	conn.mu.Unlock()
+
+	if forward && notify != nil {
+		notify(msg)
+	}
 }
 
 func (conn *Conn) subscribed(topic string) bool {
 	conn.mu.RLock()
 	defer conn.mu.RUnlock()
-	for k := range conn.topics {
-		switch {
-		case k == "":
-			// subscribed to everything
-			return true
-		case strings.HasPrefix(topic, k):
-			return true
-		}
-	}
-	return false
+	return conn.matcher.Match(topic)
 }
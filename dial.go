@@ -0,0 +1,78 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/go-zeromq/zmq4/transport"
+	"github.com/pkg/errors"
+)
+
+// Dial resolves endpoint's URI scheme (e.g. "pgm", "epgm") against the
+// transport registry populated by transport.Register, connects to it,
+// and opens a ZMTP Conn over the result via Open (which short-circuits
+// the greeting/security handshake for multicast transports, per
+// RFC 23). This is the path by which a PUB or SUB socket binds/connects
+// to a pgm://, epgm://, or any other registered Transport's endpoint.
+//
+// Endpoints whose scheme has no registered Transport (e.g. "tcp",
+// "ipc") are not handled here: dial the connection yourself with
+// net.Dial and pass it to Open instead.
+func Dial(ctx context.Context, endpoint string, sec Security, sockType SocketType, sockID SocketIdentity, server bool, heartbeat HeartbeatOptions) (*Conn, error) {
+	scheme, addr, err := splitEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := transport.Lookup(scheme)
+	if !ok {
+		return nil, transport.ErrUnknownScheme
+	}
+
+	rw, err := t.Dial(ctx, addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "zmq4: could not dial %q", endpoint)
+	}
+
+	conn, err := Open(rw, sec, sockType, sockID, server, heartbeat)
+	if err != nil {
+		rw.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Listen resolves endpoint's URI scheme against the transport registry
+// and starts accepting connections on it. Unlike Dial, Listen does not
+// call Open on the accepted connections itself (accepting doesn't know
+// the Security/SocketType/SocketIdentity to hand each one): callers
+// must Open each net.Conn obtained from the returned net.Listener's
+// Accept themselves.
+func Listen(ctx context.Context, endpoint string) (net.Listener, error) {
+	scheme, addr, err := splitEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := transport.Lookup(scheme)
+	if !ok {
+		return nil, transport.ErrUnknownScheme
+	}
+
+	return t.Listen(ctx, addr)
+}
+
+// splitEndpoint splits a "scheme://addr" endpoint, e.g.
+// "pgm://233.252.1.42:4242", into its scheme and addr parts.
+func splitEndpoint(endpoint string) (scheme, addr string, err error) {
+	i := strings.Index(endpoint, "://")
+	if i < 0 {
+		return "", "", errors.Errorf("zmq4: invalid endpoint %q", endpoint)
+	}
+	return endpoint[:i], endpoint[i+len("://"):], nil
+}
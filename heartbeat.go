@@ -0,0 +1,158 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// version3_1 is the ZMTP version advertised in the greeting once
+// heartbeating is enabled, since PING-PONG is a 3.1 feature.
+var version3_1 = Version{Major: 3, Minor: 1}
+
+// HeartbeatOptions configures the ZMTP 3.1 PING-PONG keepalive
+// (https://rfc.zeromq.org/spec:23/ZMTP/) on a Conn, corresponding to
+// the ZMQ_HEARTBEAT_IVL/_TIMEOUT/_TTL socket options:
+//
+//   - IVL is how often a PING is sent on an otherwise idle connection.
+//   - Timeout is how long to wait, after the last traffic seen from the
+//     peer, before considering it dead and closing the Conn.
+//   - TTL is advertised to the peer in the PING so it knows how long to
+//     wait for traffic from us before it gives up on the connection;
+//     zero disables advertising a TTL.
+type HeartbeatOptions struct {
+	IVL     time.Duration
+	Timeout time.Duration
+	TTL     time.Duration
+}
+
+// heartbeatState holds the mutable state backing Conn's heartbeat
+// goroutine: the deadline tracking and the means to stop the goroutine
+// when the Conn is closed.
+type heartbeatState struct {
+	mu       sync.Mutex
+	lastRecv time.Time
+	done     chan struct{}
+}
+
+// touch records that traffic was just received from the peer, resetting
+// the heartbeat liveness deadline.
+func (c *Conn) touch() {
+	c.hb.mu.Lock()
+	c.hb.lastRecv = time.Now()
+	c.hb.mu.Unlock()
+}
+
+// Heartbeat (re)configures the ZMTP 3.1 PING-PONG keepalive on an
+// already-open Conn and (re)starts the background goroutine that sends
+// periodic CmdPing commands per opts.IVL, closing the Conn if no
+// traffic (including the matching CmdPong) is seen within
+// opts.Timeout.
+//
+// Heartbeat cannot retroactively bump the ZMTP version advertised in
+// the greeting Open already sent; pass HeartbeatOptions to Open itself
+// to have 3.1 advertised from the handshake onward. Calling Heartbeat
+// with opts.IVL <= 0 disables heartbeating.
+func (conn *Conn) Heartbeat(opts HeartbeatOptions) {
+	conn.stopHeartbeat()
+
+	conn.hb.mu.Lock()
+	conn.heartbeat = opts
+	conn.hb.mu.Unlock()
+
+	if opts.IVL <= 0 {
+		return
+	}
+	conn.startHeartbeat()
+}
+
+// startHeartbeat starts the background heartbeat goroutine. conn.heartbeat
+// must already hold the desired options with IVL > 0.
+func (conn *Conn) startHeartbeat() {
+	conn.hb.mu.Lock()
+	conn.hb.lastRecv = time.Now()
+	conn.hb.done = make(chan struct{})
+	done := conn.hb.done
+	conn.hb.mu.Unlock()
+
+	go conn.heartbeatLoop(done)
+}
+
+// heartbeatLoop runs until done is closed by stopHeartbeat, or it closes
+// the Conn itself after detecting a dead peer or a failed PING send.
+// done is passed in rather than read from conn.hb on every iteration so
+// a goroutine from a previous Heartbeat call can't be woken by a
+// newer one's done channel.
+func (conn *Conn) heartbeatLoop(done chan struct{}) {
+	conn.hb.mu.Lock()
+	ivl := conn.heartbeat.IVL
+	conn.hb.mu.Unlock()
+
+	ticker := time.NewTicker(ivl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			conn.hb.mu.Lock()
+			idle := time.Since(conn.hb.lastRecv)
+			timeout := conn.heartbeat.Timeout
+			conn.hb.mu.Unlock()
+
+			if timeout > 0 && idle > timeout {
+				_ = conn.Close()
+				return
+			}
+
+			if err := conn.sendPing(); err != nil {
+				_ = conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// sendPing emits a PING command carrying the configured TTL (encoded
+// in centiseconds, per RFC 23bis) followed by a random context blob
+// that the peer is expected to echo back verbatim in its PONG.
+func (conn *Conn) sendPing() error {
+	conn.hb.mu.Lock()
+	ttl := uint16(conn.heartbeat.TTL / (10 * time.Millisecond))
+	conn.hb.mu.Unlock()
+
+	context := make([]byte, 16)
+	if _, err := rand.Read(context); err != nil {
+		return err
+	}
+
+	body := make([]byte, 2+len(context))
+	binary.BigEndian.PutUint16(body, ttl)
+	copy(body[2:], context)
+
+	return conn.SendCmd(CmdPing, body)
+}
+
+// stopHeartbeat stops the heartbeat goroutine, if any, started by
+// Heartbeat. It is safe to call more than once.
+func (conn *Conn) stopHeartbeat() {
+	conn.hb.mu.Lock()
+	done := conn.hb.done
+	conn.hb.mu.Unlock()
+
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+		// already stopped
+	default:
+		close(done)
+	}
+}
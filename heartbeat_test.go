@@ -0,0 +1,70 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// nullSecurity is a minimal Security implementation used only to drive
+// Conn through a greeting exchange in tests.
+type nullSecurity struct{}
+
+func (nullSecurity) Type() SecurityType                         { return NullSecurity }
+func (nullSecurity) Handshake(conn *Conn, server bool) error    { return nil }
+func (nullSecurity) Encrypt(w io.Writer, b []byte) (int, error) { return w.Write(b) }
+func (nullSecurity) Decrypt(w io.Writer, b []byte) (int, error) { return w.Write(b) }
+
+// TestOpenHeartbeatAdvertisesVersion31 verifies that HeartbeatOptions
+// passed to Open are reflected in the ZMTP version advertised in the
+// greeting. Heartbeat can no longer influence this, since it cannot run
+// before Open has already sent the greeting.
+func TestOpenHeartbeatAdvertisesVersion31(t *testing.T) {
+	client, server := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = Open(server, nullSecurity{}, PUB, SocketIdentity("srv"), true, HeartbeatOptions{IVL: time.Second})
+	}()
+
+	var greet [64]byte
+	if _, err := io.ReadFull(client, greet[:]); err != nil {
+		t.Fatalf("could not read greeting: %v", err)
+	}
+	client.Close()
+	<-done
+
+	major, minor := greet[10], greet[11]
+	if major != 3 || minor != 1 {
+		t.Fatalf("advertised version = %d.%d, want 3.1 when heartbeating is configured", major, minor)
+	}
+}
+
+// TestOpenNoHeartbeatAdvertisesDefaultVersion verifies that, absent
+// heartbeating, Open does not bump the advertised version.
+func TestOpenNoHeartbeatAdvertisesDefaultVersion(t *testing.T) {
+	client, server := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = Open(server, nullSecurity{}, PUB, SocketIdentity("srv"), true, HeartbeatOptions{})
+	}()
+
+	var greet [64]byte
+	if _, err := io.ReadFull(client, greet[:]); err != nil {
+		t.Fatalf("could not read greeting: %v", err)
+	}
+	client.Close()
+	<-done
+
+	if greet[11] == 1 {
+		t.Fatalf("advertised minor version = 1, want defaultVersion's minor when heartbeating is not configured")
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+// Matcher decides which topics a Conn is subscribed to. Implementations
+// must reference-count subscriptions: a topic subscribed to N times
+// only stops matching after N matching unsubscriptions, as required by
+// the SUB/XSUB wire protocol (https://rfc.zeromq.org/spec:29/PUBSUB/).
+//
+// The default Matcher used by Conn is a prefix trie (see newTrieMatcher
+// in trie.go); callers needing different matching semantics (e.g.
+// exact-match or glob topics) can install their own via
+// Conn.SetMatcher.
+type Matcher interface {
+	// Subscribe adds a reference to topic, returning true if this was
+	// the first (non-duplicate) subscription for topic.
+	Subscribe(topic string) (isNew bool)
+	// Unsubscribe removes a reference to topic, returning true if the
+	// reference count reached zero, i.e. topic no longer matches.
+	Unsubscribe(topic string) (isRemoved bool)
+	// Match reports whether topic is matched by any current
+	// subscription.
+	Match(topic string) bool
+}
+
+// SetMatcher installs m as the Matcher used to track and test this
+// Conn's subscriptions. It must be called before any SUBSCRIBE frames
+// are processed; it is not safe to call concurrently with RecvMsg.
+func (c *Conn) SetMatcher(m Matcher) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.matcher = m
+}
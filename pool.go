@@ -0,0 +1,77 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+import "sync"
+
+// BufferSecurity is an optional extension of Security for mechanisms
+// that can encrypt/decrypt directly into a caller-supplied buffer
+// (e.g. AEAD constructions like CurveZMQ's crypto_box), letting
+// Conn.send/Conn.read avoid the io.Writer-based Security.Encrypt/
+// Security.Decrypt path, and the bytes.Buffer allocation it forces on
+// the receive side. Security implementations that don't support this
+// still work: Conn falls back to the plain Security interface.
+type BufferSecurity interface {
+	Security
+
+	// EncryptInto appends the encrypted form of src to dst and returns
+	// the result, growing dst if necessary.
+	EncryptInto(dst, src []byte) ([]byte, error)
+	// DecryptInto appends the decrypted form of src to dst and returns
+	// the result, growing dst if necessary.
+	DecryptInto(dst, src []byte) ([]byte, error)
+}
+
+// secOverhead is generous headroom reserved on top of a plaintext
+// frame's size when pooling a buffer for BufferSecurity.EncryptInto,
+// covering AEAD overhead (nonces, authentication tags, ...).
+const secOverhead = 64
+
+// bufferPoolClasses size-classes frame buffers in powers of two, from
+// 64B up to 4MiB, bounding pool fragmentation while covering the
+// common range of ZMTP frame sizes.
+const bufferPoolClasses = 17
+
+var bufferPools [bufferPoolClasses]sync.Pool
+
+func init() {
+	for i := range bufferPools {
+		sz := sizeClassBytes(i)
+		bufferPools[i].New = func() interface{} {
+			return make([]byte, sz)
+		}
+	}
+}
+
+func sizeClassBytes(class int) int {
+	return 64 << uint(class)
+}
+
+func sizeClassOf(n int) int {
+	class := 0
+	for sizeClassBytes(class) < n && class < bufferPoolClasses-1 {
+		class++
+	}
+	return class
+}
+
+// getBuffer returns a []byte of length n drawn from the pool's
+// matching size class, to be returned later via putBuffer.
+func getBuffer(n int) []byte {
+	buf := bufferPools[sizeClassOf(n)].Get().([]byte)
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// putBuffer returns buf to the pool for reuse by a future getBuffer
+// call of a matching or smaller size.
+func putBuffer(buf []byte) {
+	if buf == nil {
+		return
+	}
+	bufferPools[sizeClassOf(cap(buf))].Put(buf[:cap(buf)])
+}
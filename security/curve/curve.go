@@ -0,0 +1,296 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package curve implements the CurveZMQ security mechanism as defined
+// in https://rfc.zeromq.org/spec:25/ZMTP-CURVE/ and
+// https://rfc.zeromq.org/spec:26/CURVEZMQ/.
+package curve // import "github.com/go-zeromq/zmq4/security/curve"
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// KeySize is the size, in bytes, of a CurveZMQ X25519 public or secret key.
+const KeySize = 32
+
+// NonceSize is the size, in bytes, of a crypto_box nonce.
+const NonceSize = 24
+
+var (
+	cmdHello    = "HELLO"
+	cmdWelcome  = "WELCOME"
+	cmdInitiate = "INITIATE"
+	cmdReady    = "READY"
+	cmdError    = "ERROR"
+)
+
+// KeyPair is a CurveZMQ X25519 long-term or short-term key pair.
+type KeyPair struct {
+	Public [KeySize]byte
+	Secret [KeySize]byte
+}
+
+// NewKeyPair generates a new random CurveZMQ key pair.
+func NewKeyPair() (KeyPair, error) {
+	pub, sec, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return KeyPair{}, errors.Wrapf(err, "curve: could not generate key pair")
+	}
+	return KeyPair{Public: *pub, Secret: *sec}, nil
+}
+
+// security implements the zmq4.Security interface for the CurveZMQ mechanism.
+type security struct {
+	server bool
+
+	// long-term keys.
+	serverPublic [KeySize]byte // known to both client and server
+	serverSecret [KeySize]byte // server only
+	clientPublic [KeySize]byte // client only, sent to the server during INITIATE
+	clientSecret [KeySize]byte // client only
+
+	// short-term keys, generated fresh for every connection.
+	short KeyPair
+
+	// peer's short-term public key, learned during the handshake.
+	peerShort [KeySize]byte
+
+	// nonce counters, one per direction, as required by the CurveZMQ
+	// nonce scheme: 8-byte big-endian counters prefixed with a
+	// constant string when forming the 24-byte crypto_box nonce.
+	sendNonce uint64
+	recvNonce uint64
+
+	// auth authorizes the client's long-term public key once
+	// readInitiate has cryptographically proven, via the INITIATE
+	// vouch, that the client genuinely owns it. Server only; nil means
+	// allowAny.
+	auth Authenticator
+}
+
+// Authenticator authorizes a client's long-term public key during the
+// server side of a CurveZMQ handshake. By the time Authenticate is
+// called, the client has already been cryptographically proven (via
+// the INITIATE vouch box) to own clientPublic; Authenticate only
+// decides whether that identity is allowed to connect, e.g. against an
+// ACL of known keys.
+type Authenticator interface {
+	Authenticate(clientPublic [KeySize]byte) bool
+}
+
+// AuthenticatorFunc adapts a plain function to an Authenticator.
+type AuthenticatorFunc func(clientPublic [KeySize]byte) bool
+
+// Authenticate implements Authenticator.
+func (f AuthenticatorFunc) Authenticate(clientPublic [KeySize]byte) bool {
+	return f(clientPublic)
+}
+
+// allowAny is the Authenticator used by NewServer: it accepts any
+// client whose long-term key has passed INITIATE vouch verification,
+// i.e. plain CurveZMQ authentication with no additional ACL.
+var allowAny = AuthenticatorFunc(func([KeySize]byte) bool { return true })
+
+// NewServer returns a Security implementing the CurveZMQ mechanism,
+// acting as the server side of the handshake. Every client is required
+// to prove, via the INITIATE vouch, that it owns the long-term public
+// key it claims; any client that does so is accepted. Use
+// NewServerWithAuth to additionally restrict which long-term keys are
+// allowed to connect.
+//
+// publicKey/secretKey are the server's long-term key pair.
+func NewServer(publicKey, secretKey [KeySize]byte) zmq4.Security {
+	return NewServerWithAuth(publicKey, secretKey, allowAny)
+}
+
+// NewServerWithAuth is like NewServer, but additionally authorizes each
+// client's long-term public key against auth, once readInitiate has
+// cryptographically verified (via the INITIATE vouch) that the client
+// genuinely owns it.
+func NewServerWithAuth(publicKey, secretKey [KeySize]byte, auth Authenticator) zmq4.Security {
+	return &security{
+		server:       true,
+		serverPublic: publicKey,
+		serverSecret: secretKey,
+		auth:         auth,
+	}
+}
+
+// NewClient returns a Security implementing the CurveZMQ mechanism,
+// acting as the client side of the handshake.
+//
+// serverPublicKey is the long-term public key of the server to connect to.
+// publicKey/secretKey are the client's long-term key pair.
+func NewClient(serverPublicKey, publicKey, secretKey [KeySize]byte) zmq4.Security {
+	return &security{
+		server:       false,
+		serverPublic: serverPublicKey,
+		clientPublic: publicKey,
+		clientSecret: secretKey,
+	}
+}
+
+// Type implements zmq4.Security.
+func (sec *security) Type() zmq4.SecurityType {
+	return zmq4.CurveSecurity
+}
+
+// Handshake implements zmq4.Security, performing the CurveZMQ
+// HELLO/WELCOME/INITIATE/READY command exchange over conn.SendCmd/RecvCmd.
+func (sec *security) Handshake(conn *zmq4.Conn, server bool) error {
+	short, err := NewKeyPair()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not generate short-term key pair")
+	}
+	sec.short = short
+
+	if server {
+		return sec.handshakeServer(conn)
+	}
+	return sec.handshakeClient(conn)
+}
+
+func (sec *security) handshakeClient(conn *zmq4.Conn) error {
+	hello, err := sec.buildHello()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not build HELLO")
+	}
+	if err := conn.SendCmd(cmdHello, hello); err != nil {
+		return errors.Wrapf(err, "curve: could not send HELLO")
+	}
+
+	cmd, err := conn.RecvCmd()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not recv WELCOME")
+	}
+	if cmd.Name != cmdWelcome {
+		return errors.Errorf("curve: expected WELCOME, got %q", cmd.Name)
+	}
+	if err := sec.readWelcome(cmd.Body); err != nil {
+		return errors.Wrapf(err, "curve: could not parse WELCOME")
+	}
+
+	initiate, err := sec.buildInitiate()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not build INITIATE")
+	}
+	if err := conn.SendCmd(cmdInitiate, initiate); err != nil {
+		return errors.Wrapf(err, "curve: could not send INITIATE")
+	}
+
+	cmd, err = conn.RecvCmd()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not recv READY")
+	}
+	if cmd.Name != cmdReady {
+		return errors.Errorf("curve: expected READY, got %q", cmd.Name)
+	}
+	return sec.readReady(cmd.Body)
+}
+
+func (sec *security) handshakeServer(conn *zmq4.Conn) error {
+	cmd, err := conn.RecvCmd()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not recv HELLO")
+	}
+	if cmd.Name != cmdHello {
+		return errors.Errorf("curve: expected HELLO, got %q", cmd.Name)
+	}
+	if err := sec.readHello(cmd.Body); err != nil {
+		return errors.Wrapf(err, "curve: could not parse HELLO")
+	}
+
+	welcome, err := sec.buildWelcome()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not build WELCOME")
+	}
+	if err := conn.SendCmd(cmdWelcome, welcome); err != nil {
+		return errors.Wrapf(err, "curve: could not send WELCOME")
+	}
+
+	cmd, err = conn.RecvCmd()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not recv INITIATE")
+	}
+	if cmd.Name != cmdInitiate {
+		return errors.Errorf("curve: expected INITIATE, got %q", cmd.Name)
+	}
+	if err := sec.readInitiate(cmd.Body); err != nil {
+		return errors.Wrapf(err, "curve: could not parse INITIATE")
+	}
+
+	ready, err := sec.buildReady()
+	if err != nil {
+		return errors.Wrapf(err, "curve: could not build READY")
+	}
+	return conn.SendCmd(cmdReady, ready)
+}
+
+// nextNonce returns the next short nonce for the given direction counter,
+// as "CurveZMQMESSAGE" followed by a big-endian 64-bit counter that is
+// incremented monotonically per direction, per connection.
+func nextNonce(prefix string, counter *uint64) [NonceSize]byte {
+	var nonce [NonceSize]byte
+	n := atomic.AddUint64(counter, 1)
+	copy(nonce[:], prefix)
+	binary.BigEndian.PutUint64(nonce[len(prefix):], n)
+	return nonce
+}
+
+// Encrypt implements zmq4.Security: it seals body as a CurveZMQ MESSAGE
+// command, using the short-term keys negotiated during the handshake.
+func (sec *security) Encrypt(w io.Writer, body []byte) (int, error) {
+	nonce := nextNonce("CurveZMQMESSAGEC", &sec.sendNonce)
+	if sec.server {
+		nonce = nextNonce("CurveZMQMESSAGES", &sec.sendNonce)
+	}
+
+	sealed := box.Seal(nil, body, &nonce, &sec.peerShort, &sec.short.Secret)
+	buf := make([]byte, 0, 8+len(sealed))
+	buf = append(buf, nonce[len(nonce)-8:]...)
+	buf = append(buf, sealed...)
+
+	return w.Write(buf)
+}
+
+// Decrypt implements zmq4.Security: it opens a CurveZMQ MESSAGE command
+// sealed by the peer, using the short-term keys negotiated during the
+// handshake.
+func (sec *security) Decrypt(w io.Writer, data []byte) (int, error) {
+	if len(data) < 8 {
+		return 0, errors.Errorf("curve: short message frame")
+	}
+
+	counter := binary.BigEndian.Uint64(data[:8])
+	if counter <= atomic.LoadUint64(&sec.recvNonce) {
+		return 0, errors.Errorf("curve: nonce %d is not strictly increasing (last seen %d), possible replay", counter, sec.recvNonce)
+	}
+
+	var nonce [NonceSize]byte
+	if sec.server {
+		copy(nonce[:], "CurveZMQMESSAGEC")
+	} else {
+		copy(nonce[:], "CurveZMQMESSAGES")
+	}
+	copy(nonce[len(nonce)-8:], data[:8])
+
+	out, ok := box.Open(nil, data[8:], &nonce, &sec.peerShort, &sec.short.Secret)
+	if !ok {
+		return 0, errors.Errorf("curve: could not authenticate message")
+	}
+
+	// Only advance the high-water mark once the frame has authenticated
+	// successfully, so a forged frame with a high counter can't be used
+	// to shadow-ban subsequent legitimate frames.
+	atomic.StoreUint64(&sec.recvNonce, counter)
+
+	return w.Write(out)
+}
@@ -0,0 +1,47 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curve
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestDecryptRejectsReplayedNonce checks that a MESSAGE frame can only
+// be decrypted once: replaying the exact same sealed frame a second
+// time must be rejected, since its nonce is no longer strictly
+// increasing.
+func TestDecryptRejectsReplayedNonce(t *testing.T) {
+	clientShort, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate client short key pair: %v", err)
+	}
+	serverShort, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate server short key pair: %v", err)
+	}
+
+	client := &security{server: false, short: clientShort, peerShort: serverShort.Public}
+	server := &security{server: true, short: serverShort, peerShort: clientShort.Public}
+
+	var sealed bytes.Buffer
+	if _, err := client.Encrypt(&sealed, []byte("hello")); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	frame := append([]byte(nil), sealed.Bytes()...)
+
+	var out bytes.Buffer
+	if _, err := server.Decrypt(&out, frame); err != nil {
+		t.Fatalf("first decrypt of a fresh frame failed: %v", err)
+	}
+	if got, want := out.String(), "hello"; got != want {
+		t.Fatalf("decrypted payload = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	if _, err := server.Decrypt(&out, frame); err == nil {
+		t.Fatalf("replaying the same frame should have been rejected")
+	}
+}
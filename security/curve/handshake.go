@@ -0,0 +1,210 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curve
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// boxOverhead is nacl/box's per-message Poly1305 MAC overhead: a sealed
+// box is always exactly len(plaintext)+boxOverhead bytes.
+const boxOverhead = 16
+
+// buildHello builds the body of a CurveZMQ HELLO command: the client's
+// short-term public key, boxed with a zero-filled plaintext so the
+// server can validate the client knows the protocol before any real
+// key agreement has taken place.
+func (sec *security) buildHello() ([]byte, error) {
+	var nonce [NonceSize]byte
+	copy(nonce[:], "CurveZMQHELLO---")
+	if _, err := rand.Read(nonce[16:]); err != nil {
+		return nil, err
+	}
+
+	zeros := make([]byte, 64)
+	box := box.Seal(nil, zeros, &nonce, &sec.serverPublic, &sec.short.Secret)
+
+	body := make([]byte, 0, KeySize+NonceSize-16+len(box))
+	body = append(body, sec.short.Public[:]...)
+	body = append(body, nonce[16:]...)
+	body = append(body, box...)
+	return body, nil
+}
+
+func (sec *security) readHello(body []byte) error {
+	const (
+		nonceSuffix = NonceSize - 16 // len(vnonce) - len("CurveZMQHELLO---")
+		boxLen      = 64 + boxOverhead
+	)
+	if len(body) != KeySize+nonceSuffix+boxLen {
+		return errors.Errorf("curve: malformed HELLO command")
+	}
+	copy(sec.peerShort[:], body[:KeySize])
+
+	var nonce [NonceSize]byte
+	copy(nonce[:], "CurveZMQHELLO---")
+	copy(nonce[16:], body[KeySize:KeySize+nonceSuffix])
+
+	// The HELLO box is an anti-amplification check: a peer that can't
+	// produce a box we can open with the short-term key it just claimed
+	// is rejected before we spend a WELCOME on it. buildHello seals it
+	// for our long-term key (&sec.serverPublic, known to the client
+	// ahead of time), paired with the client's short-term secret; we
+	// must open it with our long-term secret, not our own short-term
+	// one (sec.short.Secret never appears in this box at all).
+	if _, ok := box.Open(nil, body[KeySize+nonceSuffix:], &nonce, &sec.peerShort, &sec.serverSecret); !ok {
+		return errors.Errorf("curve: could not authenticate HELLO")
+	}
+	return nil
+}
+
+// buildWelcome builds the body of a CurveZMQ WELCOME command: the
+// server's freshly generated short-term public key and a server
+// cookie, boxed for the client's short-term key.
+func (sec *security) buildWelcome() ([]byte, error) {
+	var nonce [NonceSize]byte
+	copy(nonce[:], "WELCOME-")
+	if _, err := rand.Read(nonce[8:]); err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, 0, KeySize+KeySize)
+	plain = append(plain, sec.short.Secret[:]...)
+	plain = append(plain, sec.short.Public[:]...)
+
+	box := box.Seal(nil, plain, &nonce, &sec.peerShort, &sec.serverSecret)
+
+	body := make([]byte, 0, NonceSize-8+len(box))
+	body = append(body, nonce[8:]...)
+	body = append(body, box...)
+	return body, nil
+}
+
+func (sec *security) readWelcome(body []byte) error {
+	if len(body) < NonceSize-8 {
+		return errors.Errorf("curve: short WELCOME command")
+	}
+	var nonce [NonceSize]byte
+	copy(nonce[:], "WELCOME-")
+	copy(nonce[8:], body[:NonceSize-8])
+
+	plain, ok := box.Open(nil, body[NonceSize-8:], &nonce, &sec.serverPublic, &sec.short.Secret)
+	if !ok || len(plain) < 2*KeySize {
+		return errors.Errorf("curve: could not authenticate WELCOME")
+	}
+	copy(sec.peerShort[:], plain[KeySize:2*KeySize])
+	return nil
+}
+
+// buildInitiate builds the body of a CurveZMQ INITIATE command: the
+// client's long-term public key and a vouch box proving the client's
+// short-term key belongs to its long-term identity.
+func (sec *security) buildInitiate() ([]byte, error) {
+	var vnonce [NonceSize]byte
+	copy(vnonce[:], "VOUCH---")
+	if _, err := rand.Read(vnonce[8:]); err != nil {
+		return nil, err
+	}
+	vouch := box.Seal(nil, append(sec.short.Public[:], sec.serverPublic[:]...), &vnonce, &sec.peerShort, &sec.clientSecret)
+
+	plain := make([]byte, 0, KeySize+len(vnonce[8:])+len(vouch))
+	plain = append(plain, sec.clientPublic[:]...)
+	plain = append(plain, vnonce[8:]...)
+	plain = append(plain, vouch...)
+
+	var nonce [NonceSize]byte
+	copy(nonce[:], "CurveZMQINITIATE")
+	n := make([]byte, 8)
+	binary.BigEndian.PutUint64(n, 1)
+	copy(nonce[16:], n)
+
+	box := box.Seal(nil, plain, &nonce, &sec.peerShort, &sec.short.Secret)
+
+	body := make([]byte, 0, 8+len(box))
+	body = append(body, n...)
+	body = append(body, box...)
+	return body, nil
+}
+
+func (sec *security) readInitiate(body []byte) error {
+	if len(body) < 8 {
+		return errors.Errorf("curve: short INITIATE command")
+	}
+	var nonce [NonceSize]byte
+	copy(nonce[:], "CurveZMQINITIATE")
+	copy(nonce[16:], body[:8])
+
+	const vouchNonceSuffix = NonceSize - 8 // len(vnonce) - len("VOUCH---")
+
+	plain, ok := box.Open(nil, body[8:], &nonce, &sec.peerShort, &sec.short.Secret)
+	if !ok || len(plain) < KeySize+vouchNonceSuffix {
+		return errors.Errorf("curve: could not authenticate INITIATE")
+	}
+
+	var clientPublic [KeySize]byte
+	copy(clientPublic[:], plain[:KeySize])
+
+	// Open the vouch box: proof, sealed by the client's long-term
+	// secret key, that the long-term identity it just claimed
+	// (clientPublic) really does own the short-term key (sec.peerShort)
+	// used for the rest of this handshake, and that the vouch was made
+	// out to this server specifically. Without this, any peer could
+	// claim an arbitrary client identity.
+	var vnonce [NonceSize]byte
+	copy(vnonce[:], "VOUCH---")
+	copy(vnonce[8:], plain[KeySize:KeySize+vouchNonceSuffix])
+
+	vouch, ok := box.Open(nil, plain[KeySize+vouchNonceSuffix:], &vnonce, &clientPublic, &sec.short.Secret)
+	if !ok || len(vouch) != 2*KeySize {
+		return errors.Errorf("curve: could not authenticate INITIATE vouch")
+	}
+	if !bytes.Equal(vouch[:KeySize], sec.peerShort[:]) || !bytes.Equal(vouch[KeySize:], sec.serverPublic[:]) {
+		return errors.Errorf("curve: INITIATE vouch does not match this handshake")
+	}
+
+	auth := sec.auth
+	if auth == nil {
+		auth = allowAny
+	}
+	if !auth.Authenticate(clientPublic) {
+		return errors.Errorf("curve: client rejected by authenticator")
+	}
+
+	sec.clientPublic = clientPublic
+	return nil
+}
+
+// buildReady builds the body of a CurveZMQ READY command: an empty
+// metadata block, boxed for the client's short-term key, signalling
+// the server accepted the handshake.
+func (sec *security) buildReady() ([]byte, error) {
+	nonce := nextNonce("CurveZMQREADY---", &sec.sendNonce)
+	box := box.Seal(nil, nil, &nonce, &sec.peerShort, &sec.short.Secret)
+
+	body := make([]byte, 0, 8+len(box))
+	body = append(body, nonce[len(nonce)-8:]...)
+	body = append(body, box...)
+	return body, nil
+}
+
+func (sec *security) readReady(body []byte) error {
+	if len(body) < 8 {
+		return errors.Errorf("curve: short READY command")
+	}
+	var nonce [NonceSize]byte
+	copy(nonce[:], "CurveZMQREADY---")
+	copy(nonce[16:], body[:8])
+
+	_, ok := box.Open(nil, body[8:], &nonce, &sec.peerShort, &sec.short.Secret)
+	if !ok {
+		return errors.Errorf("curve: could not authenticate READY")
+	}
+	return nil
+}
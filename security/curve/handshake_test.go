@@ -0,0 +1,110 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curve
+
+import (
+	"net"
+	"testing"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// TestHandshakeRoundTrip drives a full HELLO/WELCOME/INITIATE/READY
+// exchange between a real client and server Security over a net.Pipe,
+// via zmq4.Open, and checks that a correct handshake succeeds.
+func TestHandshakeRoundTrip(t *testing.T) {
+	serverKeys, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate server key pair: %v", err)
+	}
+	clientKeys, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate client key pair: %v", err)
+	}
+
+	clientRW, serverRW := net.Pipe()
+
+	type result struct {
+		err error
+	}
+	serverDone := make(chan result, 1)
+	clientDone := make(chan result, 1)
+
+	go func() {
+		sec := NewServer(serverKeys.Public, serverKeys.Secret)
+		_, err := zmq4.Open(serverRW, sec, zmq4.PUB, zmq4.SocketIdentity("server"), true, zmq4.HeartbeatOptions{})
+		serverDone <- result{err}
+	}()
+	go func() {
+		sec := NewClient(serverKeys.Public, clientKeys.Public, clientKeys.Secret)
+		_, err := zmq4.Open(clientRW, sec, zmq4.PUB, zmq4.SocketIdentity("client"), false, zmq4.HeartbeatOptions{})
+		clientDone <- result{err}
+	}()
+
+	srv := <-serverDone
+	cli := <-clientDone
+	if srv.err != nil {
+		t.Fatalf("server side of handshake failed: %v", srv.err)
+	}
+	if cli.err != nil {
+		t.Fatalf("client side of handshake failed: %v", cli.err)
+	}
+}
+
+// TestReadInitiateRejectsTamperedVouch checks that readInitiate accepts
+// a genuine INITIATE but rejects one whose vouch box has been tampered
+// with, instead of trusting the claimed long-term client key outright.
+func TestReadInitiateRejectsTamperedVouch(t *testing.T) {
+	serverKeys, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate server key pair: %v", err)
+	}
+	clientKeys, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate client key pair: %v", err)
+	}
+	serverShort, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate server short key pair: %v", err)
+	}
+	clientShort, err := NewKeyPair()
+	if err != nil {
+		t.Fatalf("could not generate client short key pair: %v", err)
+	}
+
+	client := &security{
+		server:       false,
+		serverPublic: serverKeys.Public,
+		clientPublic: clientKeys.Public,
+		clientSecret: clientKeys.Secret,
+		short:        clientShort,
+		peerShort:    serverShort.Public,
+	}
+
+	newServer := func() *security {
+		return &security{
+			server:       true,
+			serverPublic: serverKeys.Public,
+			serverSecret: serverKeys.Secret,
+			short:        serverShort,
+			peerShort:    clientShort.Public,
+		}
+	}
+
+	body, err := client.buildInitiate()
+	if err != nil {
+		t.Fatalf("buildInitiate: %v", err)
+	}
+
+	if err := newServer().readInitiate(body); err != nil {
+		t.Fatalf("genuine INITIATE was rejected: %v", err)
+	}
+
+	tampered := append([]byte(nil), body...)
+	tampered[len(tampered)-1] ^= 0xff
+	if err := newServer().readInitiate(tampered); err == nil {
+		t.Fatalf("INITIATE with a tampered vouch box should have been rejected")
+	}
+}
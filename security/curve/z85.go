@@ -0,0 +1,103 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curve
+
+import (
+	"github.com/pkg/errors"
+)
+
+// z85Chars is the alphabet defined by ZMQ RFC 32 (Z85 encoding).
+const z85Chars = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+var z85Decoder [256]int8
+
+func init() {
+	for i := range z85Decoder {
+		z85Decoder[i] = -1
+	}
+	for i, c := range z85Chars {
+		z85Decoder[c] = int8(i)
+	}
+}
+
+// Z85Encode encodes a CurveZMQ key (or any 4-byte-aligned buffer) using
+// the Z85 encoding, as produced by the zmq_z85_encode family of helpers
+// used throughout the CurveZMQ ecosystem (e.g. libzmq/libczmq keys).
+func Z85Encode(data []byte) (string, error) {
+	if len(data)%4 != 0 {
+		return "", errors.Errorf("curve: Z85 input length must be a multiple of 4, got %d", len(data))
+	}
+
+	out := make([]byte, 0, len(data)*5/4)
+	for i := 0; i < len(data); i += 4 {
+		var value uint32
+		for j := 0; j < 4; j++ {
+			value = value*256 + uint32(data[i+j])
+		}
+		var chunk [5]byte
+		for j := 4; j >= 0; j-- {
+			chunk[j] = z85Chars[value%85]
+			value /= 85
+		}
+		out = append(out, chunk[:]...)
+	}
+	return string(out), nil
+}
+
+// Z85Decode decodes a Z85-encoded string back into raw key bytes.
+func Z85Decode(s string) ([]byte, error) {
+	if len(s)%5 != 0 {
+		return nil, errors.Errorf("curve: Z85 string length must be a multiple of 5, got %d", len(s))
+	}
+
+	out := make([]byte, 0, len(s)*4/5)
+	for i := 0; i < len(s); i += 5 {
+		var value uint32
+		for j := 0; j < 5; j++ {
+			c := s[i+j]
+			d := z85Decoder[c]
+			if d < 0 {
+				return nil, errors.Errorf("curve: invalid Z85 character %q", c)
+			}
+			value = value*85 + uint32(d)
+		}
+		var chunk [4]byte
+		for j := 3; j >= 0; j-- {
+			chunk[j] = byte(value % 256)
+			value /= 256
+		}
+		out = append(out, chunk[:]...)
+	}
+	return out, nil
+}
+
+// KeyPairFromZ85 decodes a Z85-encoded public/secret key pair, as
+// produced by `zmq_curve_keypair`/`zcert_new` and shipped by ZeroMQ
+// tools such as the ipbl and door_client examples.
+func KeyPairFromZ85(public, secret string) (KeyPair, error) {
+	var kp KeyPair
+
+	pub, err := Z85Decode(public)
+	if err != nil {
+		return kp, errors.Wrapf(err, "curve: could not decode public key")
+	}
+	if len(pub) != KeySize {
+		return kp, errors.Errorf("curve: decoded public key has wrong size %d", len(pub))
+	}
+	copy(kp.Public[:], pub)
+
+	if secret != "" {
+		sec, err := Z85Decode(secret)
+		if err != nil {
+			return kp, errors.Wrapf(err, "curve: could not decode secret key")
+		}
+		if len(sec) != KeySize {
+			return kp, errors.Errorf("curve: decoded secret key has wrong size %d", len(sec))
+		}
+		copy(kp.Secret[:], sec)
+	}
+
+	return kp, nil
+}
@@ -0,0 +1,9 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+// CurveSecurity is the security mechanism for the CurveZMQ, implemented
+// in the security/curve sub-package.
+const CurveSecurity SecurityType = "CURVE"
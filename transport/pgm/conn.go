@@ -0,0 +1,57 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pgm
+
+import (
+	"net"
+	"time"
+)
+
+// conn is a transport.Conn over a PGM/EPGM multicast group: reads and
+// writes are whole datagrams, not a byte-stream, matching the "raw
+// frames, no ZMTP framing" wire behaviour required by RFC 23 for
+// multicast transports.
+type conn struct {
+	send  *net.UDPConn
+	recv  *net.UDPConn
+	group *net.UDPAddr
+}
+
+// Multicast implements transport.Conn.
+func (c *conn) Multicast() bool { return true }
+
+// Read reads a single datagram into p. Unlike io.Reader, a short p
+// truncates the datagram rather than returning it across multiple
+// calls, matching net.PacketConn semantics.
+func (c *conn) Read(p []byte) (int, error) {
+	n, _, err := c.recv.ReadFromUDP(p)
+	return n, err
+}
+
+// Write sends p as a single datagram to the multicast group.
+func (c *conn) Write(p []byte) (int, error) {
+	return c.send.Write(p)
+}
+
+func (c *conn) Close() error {
+	err := c.send.Close()
+	if err2 := c.recv.Close(); err2 != nil && err == nil {
+		err = err2
+	}
+	return err
+}
+
+func (c *conn) LocalAddr() net.Addr  { return c.recv.LocalAddr() }
+func (c *conn) RemoteAddr() net.Addr { return c.group }
+
+func (c *conn) SetDeadline(t time.Time) error {
+	if err := c.send.SetDeadline(t); err != nil {
+		return err
+	}
+	return c.recv.SetDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error  { return c.recv.SetReadDeadline(t) }
+func (c *conn) SetWriteDeadline(t time.Time) error { return c.send.SetWriteDeadline(t) }
@@ -0,0 +1,133 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pgm implements a transport.Transport for the "pgm" and
+// "epgm" URI schemes used by ZeroMQ PUB/SUB sockets for reliable
+// multicast (https://tools.ietf.org/html/rfc3208).
+//
+// Linking against OpenPGM is not available in every build environment,
+// so this package falls back to plain UDP multicast: it gives up PGM's
+// NAK-based reliability and ordering guarantees, but preserves the
+// wire-level behaviour zmq4 cares about, namely that frames travel as
+// raw, unframed datagrams rather than over a ZMTP byte-stream.
+package pgm // import "github.com/go-zeromq/zmq4/transport/pgm"
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/go-zeromq/zmq4/transport"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	t := &pgmTransport{epgm: false}
+	transport.Register("pgm", t)
+	transport.Register("epgm", &pgmTransport{epgm: true})
+}
+
+type pgmTransport struct {
+	epgm bool // epgm:// wraps PGM inside UDP encapsulation; for the UDP fallback this makes no wire difference.
+}
+
+// Dial implements transport.Transport: it joins the multicast group
+// given by addr (host:port) and returns a transport.Conn that can send
+// and receive raw datagrams to/from the group.
+func (t *pgmTransport) Dial(ctx context.Context, addr string) (transport.Conn, error) {
+	group, iface, err := resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	sendConn, err := net.DialUDP("udp", nil, group)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pgm: could not dial %q", addr)
+	}
+
+	recvConn, err := net.ListenMulticastUDP("udp", iface, group)
+	if err != nil {
+		sendConn.Close()
+		return nil, errors.Wrapf(err, "pgm: could not join group %q", addr)
+	}
+
+	return &conn{send: sendConn, recv: recvConn, group: group}, nil
+}
+
+// Listen implements transport.Transport. PGM/EPGM pub/sub endpoints are
+// symmetric (every peer both sends and receives on the group), so
+// Listen returns a listener whose single Accept call hands back a
+// connection equivalent to the one Dial would produce.
+func (t *pgmTransport) Listen(ctx context.Context, addr string) (net.Listener, error) {
+	group, iface, err := resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	recvConn, err := net.ListenMulticastUDP("udp", iface, group)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pgm: could not join group %q", addr)
+	}
+
+	sendConn, err := net.DialUDP("udp", nil, group)
+	if err != nil {
+		recvConn.Close()
+		return nil, errors.Wrapf(err, "pgm: could not dial %q", addr)
+	}
+
+	return &listener{c: &conn{send: sendConn, recv: recvConn, group: group}, closed: make(chan struct{})}, nil
+}
+
+// resolve splits a pgm/epgm endpoint ("pgm://233.252.1.42:4242" or
+// "233.252.1.42:4242") into a multicast group address and the network
+// interface to join it on.
+func resolve(addr string) (*net.UDPAddr, *net.Interface, error) {
+	addr = strings.TrimPrefix(addr, "pgm://")
+	addr = strings.TrimPrefix(addr, "epgm://")
+
+	group, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "pgm: could not resolve %q", addr)
+	}
+
+	// a nil interface lets the OS pick the default multicast-capable
+	// interface; callers needing a specific NIC should dial by IP and
+	// rely on routing instead.
+	return group, nil, nil
+}
+
+// errListenerClosed is returned by a pending Accept once Close has been
+// called, per the net.Listener contract that Close unblocks it.
+var errListenerClosed = errors.New("pgm: listener closed")
+
+// listener implements net.Listener by handing back the same
+// multicast conn to its first Accept call; since PGM/EPGM groups have
+// a single shared connection, there is nothing further to accept, so
+// subsequent calls block until Close.
+type listener struct {
+	c      *conn
+	used   bool
+	closed chan struct{}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	if l.used {
+		<-l.closed
+		return nil, errListenerClosed
+	}
+	l.used = true
+	return l.c, nil
+}
+
+func (l *listener) Close() error {
+	select {
+	case <-l.closed:
+		// already closed
+	default:
+		close(l.closed)
+	}
+	return l.c.Close()
+}
+
+func (l *listener) Addr() net.Addr { return l.c.group }
@@ -0,0 +1,67 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package transport provides the pluggable transport layer used by
+// zmq4 to open outgoing connections and accept incoming ones for
+// schemes other than the net.Dial/net.Listen built-ins (tcp, ipc, ...).
+package transport // import "github.com/go-zeromq/zmq4/transport"
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Transport opens and accepts connections for a given URI scheme
+// (e.g. "pgm", "epgm").
+type Transport interface {
+	// Dial connects to addr and returns the resulting connection.
+	Dial(ctx context.Context, addr string) (Conn, error)
+	// Listen starts accepting connections on addr.
+	Listen(ctx context.Context, addr string) (net.Listener, error)
+}
+
+// Conn is the connection type returned by a Transport. Transports whose
+// wire framing is incompatible with ZMTP's own frame headers (e.g.
+// multicast datagram transports, per https://rfc.zeromq.org/spec:23/ZMTP/)
+// report so via Multicast, so that zmq4.Open can skip ZMTP framing and
+// the security handshake for them.
+type Conn interface {
+	io.ReadWriteCloser
+	// Multicast reports whether this connection carries raw,
+	// unframed datagrams rather than a ZMTP byte-stream.
+	Multicast() bool
+}
+
+var (
+	mu         sync.RWMutex
+	transports = make(map[string]Transport)
+)
+
+// Register registers a Transport under the given URI scheme (without
+// the trailing "://"). It panics if the scheme is already registered.
+func Register(scheme string, t Transport) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := transports[scheme]; dup {
+		panic("zmq4/transport: Register called twice for scheme " + scheme)
+	}
+	transports[scheme] = t
+}
+
+// Lookup returns the Transport registered for scheme, if any.
+func Lookup(scheme string) (Transport, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	t, ok := transports[scheme]
+	return t, ok
+}
+
+// ErrUnknownScheme is returned by zmq4 when an endpoint URI uses a
+// scheme with no registered Transport and no native net.Dial/net.Listen
+// support.
+var ErrUnknownScheme = errors.New("zmq4/transport: unknown scheme")
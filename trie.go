@@ -0,0 +1,100 @@
+// Copyright 2018 The go-zeromq Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zmq4
+
+// trieNode is a node of a byte-keyed prefix trie, shared by every
+// topic that passes through it.
+type trieNode struct {
+	children map[byte]*trieNode
+	refs     int // number of outstanding subscriptions ending exactly at this node
+}
+
+// trieMatcher is the default Matcher: a prefix trie keyed by topic
+// bytes. Unlike a map[string]struct{} scanned with strings.HasPrefix
+// for every publish, Match walks the trie once per published topic,
+// descending only as far as the topic and the trie agree.
+type trieMatcher struct {
+	root *trieNode
+}
+
+func newTrieMatcher() *trieMatcher {
+	return &trieMatcher{root: &trieNode{}}
+}
+
+// Subscribe implements Matcher.
+func (t *trieMatcher) Subscribe(topic string) bool {
+	n := t.root
+	for i := 0; i < len(topic); i++ {
+		b := topic[i]
+		if n.children == nil {
+			n.children = make(map[byte]*trieNode)
+		}
+		c, ok := n.children[b]
+		if !ok {
+			c = &trieNode{}
+			n.children[b] = c
+		}
+		n = c
+	}
+	n.refs++
+	return n.refs == 1
+}
+
+// Unsubscribe implements Matcher.
+func (t *trieMatcher) Unsubscribe(topic string) bool {
+	path := make([]*trieNode, 1, len(topic)+1)
+	path[0] = t.root
+
+	n := t.root
+	for i := 0; i < len(topic); i++ {
+		c, ok := n.children[topic[i]]
+		if !ok {
+			return false
+		}
+		n = c
+		path = append(path, n)
+	}
+	if n.refs == 0 {
+		return false
+	}
+	n.refs--
+	last := n.refs == 0
+
+	// Prune now-dead nodes (no subscription of their own, no children
+	// keeping them alive) back up to the root, so that a long-lived
+	// broker doesn't accumulate one trieNode per byte of every topic a
+	// client ever subscribed to and later unsubscribed from.
+	for i := len(path) - 1; i > 0; i-- {
+		node := path[i]
+		if node.refs > 0 || len(node.children) > 0 {
+			break
+		}
+		parent := path[i-1]
+		delete(parent.children, topic[i-1])
+	}
+
+	return last
+}
+
+// Match implements Matcher: topic matches if any prefix of it
+// (including the empty prefix, i.e. a subscription to everything) has
+// an outstanding subscription.
+func (t *trieMatcher) Match(topic string) bool {
+	n := t.root
+	if n.refs > 0 {
+		return true
+	}
+	for i := 0; i < len(topic); i++ {
+		c, ok := n.children[topic[i]]
+		if !ok {
+			return false
+		}
+		n = c
+		if n.refs > 0 {
+			return true
+		}
+	}
+	return false
+}